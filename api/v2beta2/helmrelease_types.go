@@ -0,0 +1,100 @@
+/*
+Copyright 2022 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2beta2
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HelmReleaseSpec defines the desired state of a HelmRelease.
+type HelmReleaseSpec struct {
+	// ReleaseName used for the Helm release. Defaults to a name derived
+	// from the namespace and name of the HelmRelease.
+	// +optional
+	ReleaseName string `json:"releaseName,omitempty"`
+
+	// TargetNamespace to target when performing operations for the Helm
+	// release. Defaults to the namespace of the HelmRelease.
+	// +optional
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+
+	// StorageNamespace used for the Helm storage. Defaults to the release
+	// namespace.
+	// +optional
+	StorageNamespace string `json:"storageNamespace,omitempty"`
+}
+
+// HelmReleaseStatus defines the observed state of a HelmRelease.
+type HelmReleaseStatus struct {
+	// StorageNamespace is the namespace of the Helm storage for the current
+	// release.
+	// +optional
+	StorageNamespace string `json:"storageNamespace,omitempty"`
+
+	// Current is the Snapshot of the last release made by the controller
+	// for this HelmRelease.
+	// +optional
+	Current *Snapshot `json:"current,omitempty"`
+
+	// History holds the historical Snapshots made by the controller for
+	// this HelmRelease, newest first.
+	// +optional
+	History []*Snapshot `json:"history,omitempty"`
+}
+
+// HelmRelease is the Schema for the helmreleases API.
+type HelmRelease struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   HelmReleaseSpec   `json:"spec,omitempty"`
+	Status HelmReleaseStatus `json:"status,omitempty"`
+}
+
+// GetReleaseName returns the configured release name, or a name derived
+// from the namespace and name of the HelmRelease if none is set.
+func (in *HelmRelease) GetReleaseName() string {
+	if in.Spec.ReleaseName != "" {
+		return in.Spec.ReleaseName
+	}
+	return fmt.Sprintf("%s-%s", in.Namespace, in.Name)
+}
+
+// GetReleaseNamespace returns the configured target namespace, or the
+// namespace of the HelmRelease if none is set.
+func (in *HelmRelease) GetReleaseNamespace() string {
+	if in.Spec.TargetNamespace != "" {
+		return in.Spec.TargetNamespace
+	}
+	return in.Namespace
+}
+
+// GetStorageNamespace returns the configured storage namespace, or
+// GetReleaseNamespace if none is set.
+func (in *HelmRelease) GetStorageNamespace() string {
+	if in.Spec.StorageNamespace != "" {
+		return in.Spec.StorageNamespace
+	}
+	return in.GetReleaseNamespace()
+}
+
+// GetCurrent returns the Snapshot of the last release made for the
+// HelmRelease, or nil if no release has been made yet.
+func (in *HelmRelease) GetCurrent() *Snapshot {
+	return in.Status.Current
+}
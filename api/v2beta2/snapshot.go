@@ -0,0 +1,80 @@
+/*
+Copyright 2022 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2beta2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Snapshot captures a point-in-time state of a Helm release, as recorded by
+// the controller after an install, upgrade, test, rollback or uninstall.
+type Snapshot struct {
+	// APIVersion is the API version of the Snapshot.
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Digest is the checksum of the release as observed to be made by
+	// Helm, combined with PrevDigest when that is set (see PrevDigest).
+	// It is used to detect changes to the release outside of the
+	// control of the controller, and as such acts as a validation of the
+	// integrity of the last deployed release.
+	Digest string `json:"digest,omitempty"`
+
+	// Name is the name of the release.
+	Name string `json:"name,omitempty"`
+
+	// Namespace is the namespace the release is deployed to.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Version is the version of the release object in Helm storage.
+	Version int `json:"version,omitempty"`
+
+	// Status is the current state of the release.
+	Status string `json:"status,omitempty"`
+
+	// ChartName is the chart name as configured in the HelmRelease.
+	ChartName string `json:"chartName,omitempty"`
+
+	// ChartVersion is the chart version as configured in the HelmRelease.
+	ChartVersion string `json:"chartVersion,omitempty"`
+
+	// ConfigDigest is the checksum of the config (better known as "values")
+	// as applied when the release was made.
+	ConfigDigest string `json:"configDigest,omitempty"`
+
+	// PrevDigest is the Digest of the Snapshot that preceded this one in
+	// the release history at the time this Snapshot was appended, chaining
+	// it to its predecessor. It is empty for the first Snapshot of a
+	// release. A Snapshot whose Digest was not computed over the observed
+	// release combined with PrevDigest, or whose PrevDigest does not match
+	// the Digest of its predecessor, indicates the history was mutated
+	// outside of the controller.
+	// +optional
+	PrevDigest string `json:"prevDigest,omitempty"`
+
+	// FirstDeployed is when the release was first deployed.
+	// +optional
+	FirstDeployed metav1.Time `json:"firstDeployed,omitempty"`
+
+	// LastDeployed is when the release was last deployed.
+	// +optional
+	LastDeployed metav1.Time `json:"lastDeployed,omitempty"`
+
+	// Deleted is when the release was deleted.
+	// +optional
+	Deleted metav1.Time `json:"deleted,omitempty"`
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"errors"
+	"fmt"
+
+	helmaction "helm.sh/helm/v3/pkg/action"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
+	helmrelease "helm.sh/helm/v3/pkg/release"
+
+	v2 "github.com/fluxcd/helm-controller/api/v2beta2"
+	"github.com/fluxcd/helm-controller/internal/release"
+)
+
+// TODO(ownership): this file gives the HelmRelease reconcile loop the call
+// sites it needs (Install/Upgrade/Uninstall in place of driving helmaction
+// directly) to make release ownership enforceable, but the reconciler
+// itself does not live in this package and is not wired up here. Once it
+// is, it must treat an error wrapping ErrReleaseNotOwned returned from any
+// of these three functions as terminal: set a non-remediable condition
+// (e.g. Ready=False / Stalled) with a message naming the conflicting
+// release, and stop reconciling rather than retrying or attempting to
+// adopt the release.
+
+// Install runs a Helm install for obj, stamping the resulting release with
+// OwnerLabels so that a later Upgrade or Uninstall converging on the same
+// storage namespace and release name can tell, via VerifyReleaseOwnership,
+// that it would be acting on a release that belongs to a different object.
+func Install(config *helmaction.Configuration, obj *v2.HelmRelease, chrt *helmchart.Chart, vals helmchartutil.Values) (*helmrelease.Release, error) {
+	install := helmaction.NewInstall(config)
+	install.ReleaseName = release.ShortenName(obj.GetReleaseName())
+	install.Namespace = obj.GetReleaseNamespace()
+	install.Labels = OwnerLabels(obj)
+
+	return install.Run(chrt, vals)
+}
+
+// Upgrade runs a Helm upgrade for obj. It first verifies, via
+// VerifyReleaseOwnership, that the release currently in storage is owned by
+// obj, failing fast with ErrReleaseNotOwned without touching storage if it
+// is not, and re-stamps the resulting release with OwnerLabels.
+func Upgrade(config *helmaction.Configuration, obj *v2.HelmRelease, chrt *helmchart.Chart, vals helmchartutil.Values) (*helmrelease.Release, error) {
+	cur, err := LastRelease(config, obj.GetReleaseName())
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyReleaseOwnership(cur, obj); err != nil {
+		return nil, fmt.Errorf("refusing to upgrade: %w", err)
+	}
+
+	upgrade := helmaction.NewUpgrade(config)
+	upgrade.Namespace = obj.GetReleaseNamespace()
+	upgrade.Labels = OwnerLabels(obj)
+
+	return upgrade.Run(release.ShortenName(obj.GetReleaseName()), chrt, vals)
+}
+
+// Uninstall runs a Helm uninstall for obj. It first verifies, via
+// VerifyReleaseOwnership, that the release currently in storage is owned by
+// obj, failing fast with ErrReleaseNotOwned without touching storage if it
+// is not. If no release exists for obj, it is a no-op.
+func Uninstall(config *helmaction.Configuration, obj *v2.HelmRelease) (*helmrelease.UninstallReleaseResponse, error) {
+	cur, err := LastRelease(config, obj.GetReleaseName())
+	if err != nil {
+		if errors.Is(err, ErrReleaseNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := VerifyReleaseOwnership(cur, obj); err != nil {
+		return nil, fmt.Errorf("refusing to uninstall: %w", err)
+	}
+
+	uninstall := helmaction.NewUninstall(config)
+	return uninstall.Run(release.ShortenName(obj.GetReleaseName()))
+}
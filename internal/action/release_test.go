@@ -0,0 +1,119 @@
+/*
+Copyright 2022 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	v2 "github.com/fluxcd/helm-controller/api/v2beta2"
+)
+
+func newTestHelmRelease(name, namespace string, uid types.UID) *v2.HelmRelease {
+	return &v2.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			UID:       uid,
+		},
+		Spec: v2.HelmReleaseSpec{
+			ReleaseName: name,
+		},
+	}
+}
+
+func TestVerifyReleaseOwnership(t *testing.T) {
+	obj := newTestHelmRelease("podinfo", "default", types.UID("abc-123"))
+
+	t.Run("unclaimed release is treated as owned", func(t *testing.T) {
+		g := NewWithT(t)
+		rls := newTestRelease(obj.GetReleaseName(), 1)
+		g.Expect(VerifyReleaseOwnership(rls, obj)).To(Succeed())
+	})
+
+	t.Run("release owned by the same object", func(t *testing.T) {
+		g := NewWithT(t)
+		rls := newTestRelease(obj.GetReleaseName(), 1)
+		rls.Labels = OwnerLabels(obj)
+		g.Expect(VerifyReleaseOwnership(rls, obj)).To(Succeed())
+	})
+
+	t.Run("release owned by a different object", func(t *testing.T) {
+		g := NewWithT(t)
+		rls := newTestRelease(obj.GetReleaseName(), 1)
+		other := newTestHelmRelease("podinfo", "default", types.UID("xyz-789"))
+		rls.Labels = OwnerLabels(other)
+
+		err := VerifyReleaseOwnership(rls, obj)
+		g.Expect(errors.Is(err, ErrReleaseNotOwned)).To(BeTrue())
+	})
+
+	t.Run("nil release", func(t *testing.T) {
+		g := NewWithT(t)
+		g.Expect(errors.Is(VerifyReleaseOwnership(nil, obj), ErrReleaseNotOwned)).To(BeTrue())
+	})
+}
+
+func TestUpgrade_RefusesForeignRelease(t *testing.T) {
+	g := NewWithT(t)
+
+	config := newTestConfiguration()
+	obj := newTestHelmRelease("podinfo", "default", types.UID("abc-123"))
+	other := newTestHelmRelease("podinfo", "default", types.UID("xyz-789"))
+
+	rls := newTestRelease(obj.GetReleaseName(), 1)
+	rls.Labels = OwnerLabels(other)
+	g.Expect(config.Releases.Create(rls)).To(Succeed())
+
+	chrt := &helmchart.Chart{Metadata: &helmchart.Metadata{Name: "podinfo", Version: "1.0.0"}}
+	_, err := Upgrade(config, obj, chrt, helmchartutil.Values{})
+	g.Expect(errors.Is(err, ErrReleaseNotOwned)).To(BeTrue())
+
+	// Upgrade must not have touched storage: the foreign release is still
+	// the only, unmodified revision on record.
+	last, err := LastRelease(config, obj.GetReleaseName())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(last.Version).To(Equal(1))
+}
+
+func TestUninstall_RefusesForeignRelease(t *testing.T) {
+	g := NewWithT(t)
+
+	config := newTestConfiguration()
+	obj := newTestHelmRelease("podinfo", "default", types.UID("abc-123"))
+	other := newTestHelmRelease("podinfo", "default", types.UID("xyz-789"))
+
+	rls := newTestRelease(obj.GetReleaseName(), 1)
+	rls.Labels = OwnerLabels(other)
+	g.Expect(config.Releases.Create(rls)).To(Succeed())
+
+	_, err := Uninstall(config, obj)
+	g.Expect(errors.Is(err, ErrReleaseNotOwned)).To(BeTrue())
+
+	// Uninstall must not have touched storage: the foreign release must
+	// still be present.
+	_, err = LastRelease(config, obj.GetReleaseName())
+	g.Expect(err).NotTo(HaveOccurred())
+}
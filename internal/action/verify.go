@@ -17,7 +17,9 @@ limitations under the License.
 package action
 
 import (
+	"context"
 	"errors"
+	"fmt"
 
 	"github.com/opencontainers/go-digest"
 	helmaction "helm.sh/helm/v3/pkg/action"
@@ -33,14 +35,87 @@ import (
 )
 
 var (
-	ErrReleaseDisappeared = errors.New("release disappeared from storage")
-	ErrReleaseNotFound    = errors.New("no release found")
-	ErrReleaseNotObserved = errors.New("release not observed to be made for object")
-	ErrReleaseDigest      = errors.New("release digest verification error")
-	ErrChartChanged       = errors.New("release chart changed")
-	ErrConfigDigest       = errors.New("release config values changed")
+	ErrReleaseDisappeared  = errors.New("release disappeared from storage")
+	ErrReleaseNotFound     = errors.New("no release found")
+	ErrReleaseNotObserved  = errors.New("release not observed to be made for object")
+	ErrReleaseDigest       = errors.New("release digest verification error")
+	ErrChartChanged        = errors.New("release chart changed")
+	ErrConfigDigest        = errors.New("release config values changed")
+	ErrReleaseNotOwned     = errors.New("release not owned by HelmRelease object")
+	ErrSnapshotChainBroken = errors.New("snapshot digest chain broken")
 )
 
+const (
+	// OwnerNamespaceLabel and the labels below are stamped on a Helm release
+	// (and therefore on the underlying storage Secret/ConfigMap) via the
+	// Labels field of helmaction.Install/Upgrade, so that a later
+	// VerifyReleaseOwnership call can confirm the release in storage still
+	// belongs to the HelmRelease object that is about to act on it.
+	OwnerNamespaceLabel = "helm.toolkit.fluxcd.io/owner-namespace"
+	OwnerNameLabel      = "helm.toolkit.fluxcd.io/owner-name"
+	OwnerUIDLabel       = "helm.toolkit.fluxcd.io/owner-uid"
+)
+
+// OwnerLabels returns the labels that identify obj as the owner of a Helm
+// release. Callers are expected to merge these into the Labels of the
+// helmaction.Install or helmaction.Upgrade options used to perform the
+// release, so that the ownership can be verified on every subsequent
+// reconciliation with VerifyReleaseOwnership.
+func OwnerLabels(obj *v2.HelmRelease) map[string]string {
+	return map[string]string{
+		OwnerNamespaceLabel: obj.GetNamespace(),
+		OwnerNameLabel:      obj.GetName(),
+		OwnerUIDLabel:       string(obj.GetUID()),
+	}
+}
+
+// VerifyReleaseOwnership verifies that rls is owned by obj, by comparing the
+// owner labels stamped on the release (see OwnerLabels) against obj's
+// namespace, name and UID. It returns ErrReleaseNotOwned if the release is
+// stamped with owner labels that do not match obj.
+//
+// A release with none of the owner labels set is treated as unclaimed
+// rather than as owned by someone else: every release that was installed or
+// upgraded before this check shipped predates the stamping, and failing it
+// terminally here would permanently block reconciliation of every such
+// release with no adoption path. Upgrade backfills the labels onto an
+// unclaimed release the next time it acts on it, as the new revision it
+// writes carries OwnerLabels, which is sufficient to claim it, since
+// VerifyReleaseOwnership runs again before every subsequent mutation.
+//
+// A release stamped for a different namespace, name or UID, however, is
+// treated as a hard failure: this guards against two HelmRelease objects
+// converging on the same storage namespace and release name (e.g. through
+// generateName or overlapping tenants), which would otherwise cause the
+// digest-based checks in VerifyRelease and VerifyReleaseObject to flip
+// between "not observed" states while fighting over, and potentially
+// clobbering, a release that belongs to the other object. Callers should
+// treat that case as a terminal failure rather than attempting adoption or
+// retrying.
+func VerifyReleaseOwnership(rls *helmrelease.Release, obj *v2.HelmRelease) error {
+	if rls == nil || obj == nil {
+		return ErrReleaseNotOwned
+	}
+
+	ns, hasNS := rls.Labels[OwnerNamespaceLabel]
+	name, hasName := rls.Labels[OwnerNameLabel]
+	uid, hasUID := rls.Labels[OwnerUIDLabel]
+	if !hasNS && !hasName && !hasUID {
+		return nil
+	}
+
+	switch {
+	case ns != obj.GetNamespace():
+		return ErrReleaseNotOwned
+	case name != obj.GetName():
+		return ErrReleaseNotOwned
+	case uid != string(obj.GetUID()):
+		return ErrReleaseNotOwned
+	default:
+		return nil
+	}
+}
+
 // ReleaseTargetChanged returns true if the given release and/or chart
 // name have been mutated in such a way that it no longer has the same release
 // target as the Status.Current, by comparing the (storage) namespace, and
@@ -183,3 +258,89 @@ func VerifyRelease(rls *helmrelease.Release, snapshot *v2.Snapshot, chrt *helmch
 	}
 	return nil
 }
+
+// VerifyReleaseWithResolver resolves any "ref+..." external secret
+// references in vals using resolver (see chartutil.ValueResolverRegistry),
+// and delegates to VerifyRelease with the resolved values. version scopes
+// the resolver's cache, see chartutil.ValueResolverRegistry.Resolve.
+//
+// Callers must use this, rather than calling VerifyRelease directly, when
+// vals may contain references: VerifyRelease's ErrConfigDigest check must
+// run against the concrete secret values, not the "ref+..." placeholders,
+// for an upstream secret rotation to be detected as a config change and
+// trigger an upgrade.
+func VerifyReleaseWithResolver(ctx context.Context, resolver *chartutil.ValueResolverRegistry, rls *helmrelease.Release, snapshot *v2.Snapshot, chrt *helmchart.Metadata, vals helmchartutil.Values, version string) error {
+	resolved, err := resolver.ResolveValues(ctx, vals, version)
+	if err != nil {
+		return err
+	}
+	return VerifyRelease(rls, snapshot, chrt, resolved)
+}
+
+// VerifySnapshotChain walks history newest-to-oldest. For every entry it
+// re-fetches the release from Helm storage via config.Releases.Get and
+// confirms the entry's own Digest was computed over that observed release
+// combined with the entry's own PrevDigest, so the check proves the
+// recorded entry matches what Helm actually stored rather than trusting
+// Status.History as-is. Additionally, for as long as the chain stays
+// unbroken, it requires PrevDigest to equal the Digest of the next (older)
+// entry in history, which is what actually detects a Status.History that
+// was reordered or had entries spliced out from the middle.
+//
+// Status.History predating the introduction of PrevDigest - or simply
+// pruned by Helm/the controller's history retention - has no way to carry a
+// valid link to whatever came before it, so an entry with an empty
+// PrevDigest is treated as the start of what can be verified: everything
+// from there on (older) is presumed to predate the chain and is left
+// unchecked rather than reported as broken. This means tampering that
+// removes entries exactly at that boundary is not detected; only the
+// portion of history made after PrevDigest started being recorded offers
+// the tamper-evidence guarantee.
+//
+// It returns an error of type ErrReleaseDisappeared, ErrReleaseDigest or
+// ErrSnapshotChainBroken, wrapped with the index of the offending entry, or
+// nil if the verifiable portion of the chain is intact.
+func VerifySnapshotChain(config *helmaction.Configuration, history []*v2.Snapshot) error {
+	for i, snapshot := range history {
+		rls, err := config.Releases.Get(snapshot.Name, snapshot.Version)
+		if err != nil {
+			if errors.Is(err, helmdriver.ErrReleaseNotFound) {
+				return fmt.Errorf("%w: at index %d", ErrReleaseDisappeared, i)
+			}
+			return err
+		}
+
+		relDig, err := digest.Parse(snapshot.Digest)
+		if err != nil {
+			return fmt.Errorf("%w: at index %d", ErrReleaseDigest, i)
+		}
+		verifier := relDig.Verifier()
+
+		obs := release.ObserveRelease(rls)
+		if err = obs.Encode(verifier); err != nil {
+			return err
+		}
+		if snapshot.PrevDigest != "" {
+			if _, err = verifier.Write([]byte(snapshot.PrevDigest)); err != nil {
+				return err
+			}
+		}
+		if !verifier.Verified() {
+			return fmt.Errorf("%w: at index %d", ErrSnapshotChainBroken, i)
+		}
+
+		next := i + 1
+		if next >= len(history) {
+			continue
+		}
+		if snapshot.PrevDigest == "" {
+			// Nothing older than this can be chain-verified; stop here
+			// rather than failing on data that predates PrevDigest.
+			return nil
+		}
+		if snapshot.PrevDigest != history[next].Digest {
+			return fmt.Errorf("%w: at index %d", ErrSnapshotChainBroken, i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2022 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	helmaction "helm.sh/helm/v3/pkg/action"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	helmrelease "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	helmdriver "helm.sh/helm/v3/pkg/storage/driver"
+
+	v2 "github.com/fluxcd/helm-controller/api/v2beta2"
+	"github.com/fluxcd/helm-controller/internal/release"
+)
+
+func newTestConfiguration() *helmaction.Configuration {
+	return &helmaction.Configuration{Releases: storage.Init(helmdriver.NewMemory())}
+}
+
+func newTestRelease(name string, version int) *helmrelease.Release {
+	return &helmrelease.Release{
+		Name:      name,
+		Namespace: "default",
+		Version:   version,
+		Info:      &helmrelease.Info{Status: helmrelease.StatusDeployed},
+		Chart: &helmchart.Chart{
+			Metadata: &helmchart.Metadata{Name: "podinfo", Version: "1.0.0"},
+		},
+		Config:   map[string]interface{}{"replicas": 1},
+		Manifest: "kind: ConfigMap",
+	}
+}
+
+// buildChain stores count releases named name in config, appending a
+// chained Snapshot for each, and returns the resulting history in the
+// newest-to-oldest order VerifySnapshotChain expects.
+func buildChain(g Gomega, config *helmaction.Configuration, name string, count int) []*v2.Snapshot {
+	var history []*v2.Snapshot
+	var prev *v2.Snapshot
+	for i := 1; i <= count; i++ {
+		rls := newTestRelease(name, i)
+		g.Expect(config.Releases.Create(rls)).To(Succeed())
+
+		snap, err := release.NewSnapshot(rls, prev)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		history = append([]*v2.Snapshot{snap}, history...)
+		prev = snap
+	}
+	return history
+}
+
+func TestVerifySnapshotChain(t *testing.T) {
+	g := NewWithT(t)
+
+	config := newTestConfiguration()
+	history := buildChain(g, config, "podinfo", 3)
+
+	g.Expect(VerifySnapshotChain(config, history)).To(Succeed())
+}
+
+func TestVerifySnapshotChain_DetectsTamperedEntry(t *testing.T) {
+	g := NewWithT(t)
+
+	config := newTestConfiguration()
+	history := buildChain(g, config, "podinfo", 3)
+
+	// Simulate a rewritten Status.History: an entry's Digest is swapped out
+	// without updating the chain around it.
+	history[1].Digest = history[0].Digest
+
+	err := VerifySnapshotChain(config, history)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(errors.Is(err, ErrSnapshotChainBroken)).To(BeTrue())
+}
+
+func TestVerifySnapshotChain_DetectsDroppedEntry(t *testing.T) {
+	g := NewWithT(t)
+
+	config := newTestConfiguration()
+	history := buildChain(g, config, "podinfo", 4)
+
+	// Simulate a rewritten Status.History: an entry is spliced out of the
+	// middle of the chain, so its neighbour's PrevDigest no longer matches
+	// anything in the list. Unlike dropping the oldest entry, this is not
+	// indistinguishable from legitimate history retention, so it must
+	// always be caught.
+	history = append(history[:2], history[3])
+
+	err := VerifySnapshotChain(config, history)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(errors.Is(err, ErrSnapshotChainBroken)).To(BeTrue())
+}
+
+func TestVerifySnapshotChain_ToleratesLegacyHistory(t *testing.T) {
+	g := NewWithT(t)
+
+	config := newTestConfiguration()
+
+	// v1 and v2 simulate Snapshots recorded before PrevDigest existed: both
+	// carry an empty PrevDigest even though v2 has a real predecessor in
+	// storage.
+	rls1 := newTestRelease("podinfo", 1)
+	g.Expect(config.Releases.Create(rls1)).To(Succeed())
+	legacy1, err := release.NewSnapshot(rls1, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	rls2 := newTestRelease("podinfo", 2)
+	g.Expect(config.Releases.Create(rls2)).To(Succeed())
+	legacy2, err := release.NewSnapshot(rls2, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// v3 is the first Snapshot made after the chain feature shipped: it has
+	// nothing valid to chain to, since legacy2 was never assigned a chain
+	// digest, so it also carries an empty PrevDigest.
+	rls3 := newTestRelease("podinfo", 3)
+	g.Expect(config.Releases.Create(rls3)).To(Succeed())
+	v3, err := release.NewSnapshot(rls3, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// v4 is properly chained to v3.
+	rls4 := newTestRelease("podinfo", 4)
+	g.Expect(config.Releases.Create(rls4)).To(Succeed())
+	v4, err := release.NewSnapshot(rls4, v3)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	history := []*v2.Snapshot{v4, v3, legacy2, legacy1}
+
+	g.Expect(VerifySnapshotChain(config, history)).To(Succeed())
+}
+
+func TestVerifySnapshotChain_DetectsMissingRelease(t *testing.T) {
+	g := NewWithT(t)
+
+	config := newTestConfiguration()
+
+	rls := newTestRelease("podinfo", 1)
+	snap, err := release.NewSnapshot(rls, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// rls was never stored in config, so the chain verification must fail
+	// to find it rather than trusting the recorded Snapshot.
+	err = VerifySnapshotChain(config, []*v2.Snapshot{snap})
+	g.Expect(errors.Is(err, ErrReleaseDisappeared)).To(BeTrue())
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2022 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chartutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
+)
+
+// RefValuePrefix is the prefix that marks a string value in a HelmRelease's
+// spec.values/valuesFrom as an external secret reference, e.g.
+// "ref+vault://secret/data/foo#bar". References are resolved to their
+// concrete value before the config digest used by VerifyValues is computed,
+// so that an upstream secret rotation is detected as a config change.
+const RefValuePrefix = "ref+"
+
+// ErrUnsupportedScheme is returned when a "ref+<scheme>://..." value has no
+// ValueResolver registered for its scheme.
+var ErrUnsupportedScheme = errors.New("no ValueResolver registered for reference scheme")
+
+// ValueResolver resolves external secret references of the form
+// "ref+<scheme>://..." into their concrete values. Implementations wrap a
+// single backend (Vault, a cloud secret manager, SOPS, a plain file, ...)
+// and are looked up in a ValueResolverRegistry by the scheme portion of the
+// reference.
+type ValueResolver interface {
+	// Scheme returns the backend scheme this resolver handles, e.g. "vault"
+	// for "ref+vault://..." references.
+	Scheme() string
+
+	// Resolve returns the concrete value ref points to.
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// maxCacheEntries bounds the size of a ValueResolverRegistry's cache. It is
+// keyed by (ref, version), so a registry shared across many HelmReleases (or
+// reconciled across many generations) would otherwise grow without bound;
+// once the limit is hit the cache is dropped wholesale rather than tracking
+// per-entry recency, trading a burst of cache misses for a simple eviction
+// policy.
+const maxCacheEntries = 4096
+
+type refCacheKey struct {
+	ref     string
+	version string
+}
+
+// ValueResolverRegistry dispatches "ref+..." values to the ValueResolver
+// registered for their scheme, and caches resolved values keyed by the
+// reference and a caller-supplied version, so that repeated reconciles do
+// not hit the backend for a reference that has not changed. The cache is
+// shared across callers, so distinct (ref, version) pairs for the same
+// reference - e.g. the same secret used by two HelmReleases at different
+// generations - are cached independently instead of evicting one another.
+type ValueResolverRegistry struct {
+	mu        sync.RWMutex
+	resolvers map[string]ValueResolver
+	cache     map[refCacheKey]string
+}
+
+// NewValueResolverRegistry returns an empty ValueResolverRegistry. Backends
+// are wired in with Register; a scheme with no registered backend fails with
+// ErrUnsupportedScheme. No controller flag enables or disables backends.
+func NewValueResolverRegistry() *ValueResolverRegistry {
+	return &ValueResolverRegistry{
+		resolvers: make(map[string]ValueResolver),
+		cache:     make(map[refCacheKey]string),
+	}
+}
+
+// Register adds resolver to the registry, replacing any resolver previously
+// registered for the same scheme.
+func (r *ValueResolverRegistry) Register(resolver ValueResolver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resolvers[resolver.Scheme()] = resolver
+}
+
+// Resolve returns the concrete value for ref, using the ValueResolver
+// registered for its scheme. version scopes the cache entry (e.g. the
+// HelmRelease's generation): passing a new version forces a fresh lookup,
+// while repeating the same (ref, version) pair is served from cache without
+// hitting the backend again.
+func (r *ValueResolverRegistry) Resolve(ctx context.Context, ref, version string) (string, error) {
+	key := refCacheKey{ref: ref, version: version}
+
+	r.mu.RLock()
+	v, ok := r.cache[key]
+	r.mu.RUnlock()
+	if ok {
+		return v, nil
+	}
+
+	scheme, _, ok := strings.Cut(strings.TrimPrefix(ref, RefValuePrefix), "://")
+	if !ok {
+		return "", fmt.Errorf("invalid reference %q: missing scheme", ref)
+	}
+
+	r.mu.RLock()
+	resolver, ok := r.resolvers[scheme]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedScheme, scheme)
+	}
+
+	v, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %q: %w", ref, err)
+	}
+
+	r.mu.Lock()
+	if len(r.cache) >= maxCacheEntries {
+		r.cache = make(map[refCacheKey]string, maxCacheEntries/2)
+	}
+	r.cache[key] = v
+	r.mu.Unlock()
+	return v, nil
+}
+
+// ResolveValues walks vals and returns a copy with every string value
+// matching the RefValuePrefix pattern replaced by the value returned by the
+// ValueResolver registered for its scheme. vals itself is left untouched.
+//
+// The result, not the original "ref+..." placeholders, is what must be
+// passed to VerifyValues: resolving references before the config digest is
+// computed is what allows an upstream secret rotation to be detected as a
+// config change and trigger an upgrade.
+func (r *ValueResolverRegistry) ResolveValues(ctx context.Context, vals helmchartutil.Values, version string) (helmchartutil.Values, error) {
+	resolved, err := r.resolveAny(ctx, map[string]interface{}(vals), version)
+	if err != nil {
+		return nil, err
+	}
+	return helmchartutil.Values(resolved.(map[string]interface{})), nil
+}
+
+func (r *ValueResolverRegistry) resolveAny(ctx context.Context, v interface{}, version string) (interface{}, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			rv, err := r.resolveAny(ctx, v, version)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			out[k] = rv
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, v := range t {
+			rv, err := r.resolveAny(ctx, v, version)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rv
+		}
+		return out, nil
+	case string:
+		if !strings.HasPrefix(t, RefValuePrefix) {
+			return t, nil
+		}
+		return r.Resolve(ctx, t, version)
+	default:
+		return v, nil
+	}
+}
+
+// FileResolver resolves "ref+file://<path>" references by reading the file
+// at path, confined to Root. It backs the "ref+file://" scheme, typically
+// used for SOPS-decrypted files already materialised on disk from a Flux
+// Source. It is the only ValueResolver implementation provided: there are no
+// Vault, AWS/GCP/Azure secret manager or SOPS-over-source-ref resolvers, so
+// references with those schemes fail with ErrUnsupportedScheme unless a
+// resolver for them is registered.
+type FileResolver struct {
+	// Root is joined with the path of every reference, and every resolved
+	// path is required to stay under it, confining resolution to a
+	// directory such as a Source artifact checkout. Root must be set: a
+	// zero-value FileResolver would otherwise read any path the controller
+	// process can access, so Resolve fails closed instead.
+	Root string
+}
+
+// Scheme returns "file".
+func (r *FileResolver) Scheme() string {
+	return "file"
+}
+
+// Resolve implements ValueResolver.
+func (r *FileResolver) Resolve(_ context.Context, ref string) (string, error) {
+	if r.Root == "" {
+		return "", errors.New("FileResolver.Root must be set to confine which paths can be read")
+	}
+
+	path := strings.TrimPrefix(ref, RefValuePrefix+"file://")
+	joined := filepath.Join(r.Root, path)
+	if joined != r.Root && !strings.HasPrefix(joined, r.Root+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q escapes root %q", path, r.Root)
+	}
+
+	b, err := os.ReadFile(joined)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\n"), nil
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2022 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chartutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
+)
+
+type fakeResolver struct {
+	scheme string
+	calls  int
+	value  string
+	err    error
+}
+
+func (f *fakeResolver) Scheme() string { return f.scheme }
+
+func (f *fakeResolver) Resolve(_ context.Context, _ string) (string, error) {
+	f.calls++
+	return f.value, f.err
+}
+
+func TestValueResolverRegistry_ResolveValues(t *testing.T) {
+	g := NewWithT(t)
+
+	resolver := &fakeResolver{scheme: "vault", value: "s3cr3t"}
+	reg := NewValueResolverRegistry()
+	reg.Register(resolver)
+
+	vals := helmchartutil.Values{
+		"plain": "unchanged",
+		"nested": map[string]interface{}{
+			"password": "ref+vault://secret/data/foo#password",
+			"list": []interface{}{
+				"ref+vault://secret/data/foo#other",
+				"literal",
+			},
+		},
+	}
+
+	resolved, err := reg.ResolveValues(context.Background(), vals, "1")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(resolved["plain"]).To(Equal("unchanged"))
+
+	nested := resolved["nested"].(map[string]interface{})
+	g.Expect(nested["password"]).To(Equal("s3cr3t"))
+
+	list := nested["list"].([]interface{})
+	g.Expect(list[0]).To(Equal("s3cr3t"))
+	g.Expect(list[1]).To(Equal("literal"))
+
+	// The original values must be left untouched.
+	g.Expect(vals["nested"].(map[string]interface{})["password"]).To(Equal("ref+vault://secret/data/foo#password"))
+}
+
+func TestValueResolverRegistry_ResolveValues_Drift(t *testing.T) {
+	g := NewWithT(t)
+
+	resolver := &fakeResolver{scheme: "vault", value: "old-value"}
+	reg := NewValueResolverRegistry()
+	reg.Register(resolver)
+
+	vals := helmchartutil.Values{"password": "ref+vault://secret/data/foo#password"}
+
+	first, err := reg.ResolveValues(context.Background(), vals, "1")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(first["password"]).To(Equal("old-value"))
+
+	// A secret rotation is represented here by the backend now returning a
+	// different value; passing the same version must still serve the
+	// cached value, so the caller needs to bump version to observe it.
+	resolver.value = "new-value"
+
+	cached, err := reg.ResolveValues(context.Background(), vals, "1")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cached["password"]).To(Equal("old-value"))
+	g.Expect(resolver.calls).To(Equal(1))
+
+	rotated, err := reg.ResolveValues(context.Background(), vals, "2")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rotated["password"]).To(Equal("new-value"))
+	g.Expect(resolver.calls).To(Equal(2))
+}
+
+func TestValueResolverRegistry_Resolve_UnsupportedScheme(t *testing.T) {
+	g := NewWithT(t)
+
+	reg := NewValueResolverRegistry()
+	_, err := reg.Resolve(context.Background(), "ref+awssm://foo", "1")
+	g.Expect(err).To(MatchError(ErrUnsupportedScheme))
+}
+
+func TestFileResolver_Resolve(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(dir, "password"), []byte("hunter2\n"), 0o600)).To(Succeed())
+
+	r := &FileResolver{Root: dir}
+	v, err := r.Resolve(context.Background(), RefValuePrefix+"file://password")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(v).To(Equal("hunter2"))
+}
+
+func TestFileResolver_Resolve_RejectsPathEscape(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "checkout")
+	g.Expect(os.MkdirAll(sub, 0o700)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "secret"), []byte("top-secret"), 0o600)).To(Succeed())
+
+	r := &FileResolver{Root: sub}
+	_, err := r.Resolve(context.Background(), RefValuePrefix+"file://../secret")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestFileResolver_Resolve_RequiresRoot(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &FileResolver{}
+	_, err := r.Resolve(context.Background(), RefValuePrefix+"file:///etc/shadow")
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"github.com/opencontainers/go-digest"
+	helmrelease "helm.sh/helm/v3/pkg/release"
+
+	v2 "github.com/fluxcd/helm-controller/api/v2beta2"
+)
+
+// NewSnapshot builds a new v2beta2.Snapshot for rls, chaining its Digest to
+// prev, the most recent Snapshot in Status.History (or nil if rls is the
+// first release made for the object). The Digest is computed over the
+// observed release (see ObserveRelease) combined with prev's Digest, and
+// prev's Digest is carried over verbatim as PrevDigest, so that
+// action.VerifySnapshotChain can later detect a Status.History that was
+// reordered or had entries removed from the middle outside of this function.
+// Removal of the oldest entries is not detected.
+func NewSnapshot(rls *helmrelease.Release, prev *v2.Snapshot) (*v2.Snapshot, error) {
+	var prevDigest string
+	if prev != nil {
+		prevDigest = prev.Digest
+	}
+
+	digester := digest.Canonical.Digester()
+	obs := ObserveRelease(rls)
+	if err := obs.Encode(digester.Hash()); err != nil {
+		return nil, err
+	}
+	if prevDigest != "" {
+		if _, err := digester.Hash().Write([]byte(prevDigest)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &v2.Snapshot{
+		Digest:       digester.Digest().String(),
+		PrevDigest:   prevDigest,
+		Name:         rls.Name,
+		Namespace:    rls.Namespace,
+		Version:      rls.Version,
+		Status:       rls.Info.Status.String(),
+		ChartName:    rls.Chart.Metadata.Name,
+		ChartVersion: rls.Chart.Metadata.Version,
+	}, nil
+}